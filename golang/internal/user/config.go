@@ -0,0 +1,117 @@
+package user
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenConfig configures how the Service issues access tokens. Injecting it
+// (instead of reading a global constants package) lets tests run with their
+// own settings. The signing/verification key material itself lives in the
+// Keyring passed to NewService, which is what actually gets rotated.
+type TokenConfig struct {
+	AccessTTL time.Duration
+	Issuer    string
+}
+
+// KeyEntry is a single signing/verification key identified by its JWT "kid"
+type KeyEntry struct {
+	KeyID     string
+	Method    jwt.SigningMethod
+	SecretKey []byte         // used to sign and verify HMAC-signed tokens
+	PublicKey *rsa.PublicKey // exposed via PublicJWKS for RSA-signed tokens
+}
+
+// Keyring holds every key the service currently accepts, keyed by "kid", so
+// tokens signed before a rotation keep validating while Login signs new
+// tokens with only the newest key
+type Keyring struct {
+	mu        sync.RWMutex
+	keys      map[string]*KeyEntry
+	activeKID string
+}
+
+// NewKeyring builds a Keyring that signs with active and additionally
+// accepts previous for verification, e.g. during a rotation window
+func NewKeyring(active *KeyEntry, previous ...*KeyEntry) *Keyring {
+	kr := &Keyring{keys: map[string]*KeyEntry{}}
+	kr.Add(active)
+	kr.activeKID = active.KeyID
+	for _, k := range previous {
+		kr.Add(k)
+	}
+	return kr
+}
+
+// Add registers or replaces a key in the keyring
+func (kr *Keyring) Add(entry *KeyEntry) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.keys[entry.KeyID] = entry
+}
+
+// Active returns the key new tokens should be signed with
+func (kr *Keyring) Active() *KeyEntry {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.keys[kr.activeKID]
+}
+
+// Rotate makes entry the active signing key while keeping it retrievable
+// for verification, without dropping the keys already registered
+func (kr *Keyring) Rotate(entry *KeyEntry) {
+	kr.Add(entry)
+	kr.mu.Lock()
+	kr.activeKID = entry.KeyID
+	kr.mu.Unlock()
+}
+
+// Get looks up a key by its "kid", used to verify a token signed by a
+// current or recently-rotated key
+func (kr *Keyring) Get(kid string) (*KeyEntry, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[kid]
+	return k, ok
+}
+
+// PublicJWKS renders the RSA keys in the keyring as a JSON Web Key Set so
+// other services can verify our tokens without sharing the HMAC secret
+func (kr *Keyring) PublicJWKS() ([]byte, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	type jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	for _, k := range kr.keys {
+		if k.PublicKey == nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: k.KeyID,
+			Alg: k.Method.Alg(),
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(k.PublicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.PublicKey.E)).Bytes()),
+		})
+	}
+
+	return json.Marshal(set)
+}
@@ -0,0 +1,69 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestKeyring_RotatePreservesOldKeyForVerification(t *testing.T) {
+	original := &KeyEntry{KeyID: "k1", Method: jwt.SigningMethodHS256, SecretKey: []byte("secret-1")}
+	kr := NewKeyring(original)
+
+	if kr.Active().KeyID != "k1" {
+		t.Fatalf("expected k1 to be active, got %q", kr.Active().KeyID)
+	}
+
+	rotated := &KeyEntry{KeyID: "k2", Method: jwt.SigningMethodHS256, SecretKey: []byte("secret-2")}
+	kr.Rotate(rotated)
+
+	if kr.Active().KeyID != "k2" {
+		t.Fatalf("expected k2 to become active after Rotate, got %q", kr.Active().KeyID)
+	}
+
+	if _, ok := kr.Get("k1"); !ok {
+		t.Fatalf("expected the pre-rotation key to still be retrievable for verification")
+	}
+	if entry, ok := kr.Get("k2"); !ok || string(entry.SecretKey) != "secret-2" {
+		t.Fatalf("expected the rotated key to be retrievable")
+	}
+	if _, ok := kr.Get("unknown"); ok {
+		t.Fatalf("expected an unregistered kid to be absent")
+	}
+}
+
+func TestKeyring_PublicJWKSIncludesOnlyRSAKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	kr := NewKeyring(
+		&KeyEntry{KeyID: "hmac-kid", Method: jwt.SigningMethodHS256, SecretKey: []byte("secret")},
+		&KeyEntry{KeyID: "rsa-kid", Method: jwt.SigningMethodRS256, PublicKey: &rsaKey.PublicKey},
+	)
+
+	raw, err := kr.PublicJWKS()
+	if err != nil {
+		t.Fatalf("PublicJWKS: %v", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if len(set.Keys) != 1 {
+		t.Fatalf("expected exactly one JWK (the RSA key), got %d", len(set.Keys))
+	}
+	if set.Keys[0].Kid != "rsa-kid" {
+		t.Fatalf("expected the RSA key's kid, got %q", set.Keys[0].Kid)
+	}
+}
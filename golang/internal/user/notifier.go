@@ -0,0 +1,40 @@
+package user
+
+import "context"
+
+// Notifier delivers a short message to a user through some out-of-band
+// channel (SMS, email, ...) so the user package isn't coupled to a
+// specific transport
+type Notifier interface {
+	Notify(ctx context.Context, recipient string, message string) error
+}
+
+// SMSNotifier sends notifications through an SMS gateway
+type SMSNotifier struct {
+	sender func(ctx context.Context, phone string, message string) error
+}
+
+// NewSMSNotifier creates a Notifier backed by the given SMS send function
+func NewSMSNotifier(sender func(ctx context.Context, phone string, message string) error) *SMSNotifier {
+	return &SMSNotifier{sender: sender}
+}
+
+// Notify sends message to recipient via SMS
+func (n *SMSNotifier) Notify(ctx context.Context, recipient string, message string) error {
+	return n.sender(ctx, recipient, message)
+}
+
+// EmailNotifier sends notifications through an email transport
+type EmailNotifier struct {
+	sender func(ctx context.Context, email string, message string) error
+}
+
+// NewEmailNotifier creates a Notifier backed by the given email send function
+func NewEmailNotifier(sender func(ctx context.Context, email string, message string) error) *EmailNotifier {
+	return &EmailNotifier{sender: sender}
+}
+
+// Notify sends message to recipient via email
+func (n *EmailNotifier) Notify(ctx context.Context, recipient string, message string) error {
+	return n.sender(ctx, recipient, message)
+}
@@ -0,0 +1,329 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riskiramdan/efishery/golang/internal/types"
+)
+
+// Errors
+var (
+	ErrUnknownOAuthProvider = errors.New("unknown oauth provider")
+	ErrOAuthExchangeFailed  = errors.New("failed to exchange oauth code")
+	ErrOAuthUserInfoFailed  = errors.New("failed to fetch oauth userinfo")
+	ErrInvalidOAuthState    = errors.New("invalid or expired oauth state")
+)
+
+// oauthStateTTL is how long a state issued by BeginOAuthLogin remains valid
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthConfig holds the settings needed to talk to a single OAuth2 provider
+type OAuthConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthorizeURL string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+}
+
+// OAuthUserInfo is the normalized subset of userinfo fields we care about,
+// regardless of which provider returned them
+type OAuthUserInfo struct {
+	ProviderID    string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// oauthStateStore tracks the CSRF state nonces issued by BeginOAuthLogin
+// until they are either redeemed by OAuthLogin or expire
+type oauthStateStore struct {
+	mu    sync.Mutex
+	items map[string]oauthStateEntry
+}
+
+type oauthStateEntry struct {
+	provider  string
+	expiresAt time.Time
+}
+
+func newOAuthStateStore() *oauthStateStore {
+	return &oauthStateStore{items: map[string]oauthStateEntry{}}
+}
+
+// issue records a freshly generated state for provider
+func (st *oauthStateStore) issue(provider string, state string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.items[state] = oauthStateEntry{provider: provider, expiresAt: time.Now().Add(oauthStateTTL)}
+}
+
+// redeem consumes state, returning false if it was never issued, already
+// redeemed, expired, or issued for a different provider
+func (st *oauthStateStore) redeem(provider string, state string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	entry, ok := st.items[state]
+	delete(st.items, state)
+	if !ok || entry.provider != provider || entry.expiresAt.Before(time.Now()) {
+		return false
+	}
+	return true
+}
+
+// oauthTokenResponse is the subset of an OAuth2 token endpoint response we need
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+}
+
+// RegisterOAuthProvider registers or replaces the config for a provider name
+// (e.g. "google", "github") so it can be used with OAuthLogin
+func (s *Service) RegisterOAuthProvider(cfg OAuthConfig) {
+	if s.oauthProviders == nil {
+		s.oauthProviders = map[string]OAuthConfig{}
+	}
+	if s.oauthStates == nil {
+		s.oauthStates = newOAuthStateStore()
+	}
+	s.oauthProviders[cfg.Name] = cfg
+}
+
+// BeginOAuthLogin generates a CSRF state nonce for provider, stashes it until
+// it is redeemed by a matching OAuthLogin call or expires, and returns the
+// URL the caller should redirect the user to
+func (s *Service) BeginOAuthLogin(ctx context.Context, provider string) (string, string, *types.Error) {
+	cfg, ok := s.oauthProviders[provider]
+	if !ok {
+		return "", "", &types.Error{
+			Path:    ".UserService->BeginOAuthLogin()",
+			Message: ErrUnknownOAuthProvider.Error(),
+			Error:   ErrUnknownOAuthProvider,
+			Type:    "validation-error",
+		}
+	}
+
+	state, err := randomToken(16)
+	if err != nil {
+		return "", "", &types.Error{
+			Path:    ".UserService->BeginOAuthLogin()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "golang-error",
+		}
+	}
+	s.oauthStates.issue(provider, state)
+
+	values := url.Values{}
+	values.Set("client_id", cfg.ClientID)
+	values.Set("redirect_uri", cfg.RedirectURL)
+	values.Set("response_type", "code")
+	values.Set("state", state)
+	if len(cfg.Scopes) > 0 {
+		values.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+
+	return cfg.AuthorizeURL + "?" + values.Encode(), state, nil
+}
+
+// OAuthLogin exchanges an authorization code for a provider token, fetches the
+// provider's userinfo, and links or creates a User before issuing our own JWT
+func (s *Service) OAuthLogin(ctx context.Context, provider string, code string, state string) (*LoginResponse, *types.Error) {
+	cfg, ok := s.oauthProviders[provider]
+	if !ok {
+		return nil, &types.Error{
+			Path:    ".UserService->OAuthLogin()",
+			Message: ErrUnknownOAuthProvider.Error(),
+			Error:   ErrUnknownOAuthProvider,
+			Type:    "validation-error",
+		}
+	}
+
+	if !s.oauthStates.redeem(provider, state) {
+		return nil, &types.Error{
+			Path:    ".UserService->OAuthLogin()",
+			Message: ErrInvalidOAuthState.Error(),
+			Error:   ErrInvalidOAuthState,
+			Type:    "validation-error",
+		}
+	}
+
+	info, err := s.exchangeOAuthCode(ctx, cfg, code)
+	if err != nil {
+		return nil, &types.Error{
+			Path:    ".UserService->OAuthLogin()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "golang-error",
+		}
+	}
+
+	user, errType := s.findOrCreateOAuthUser(ctx, provider, info)
+	if errType != nil {
+		errType.Path = ".UserService->OAuthLogin()" + errType.Path
+		return nil, errType
+	}
+
+	t, tClaims, tokenExpiredAt, errType := s.issueToken(ctx, user)
+	if errType != nil {
+		errType.Path = ".UserService->OAuthLogin()" + errType.Path
+		return nil, errType
+	}
+	jti, _ := tClaims["jti"].(string)
+
+	if s.persistToken {
+		now := time.Now()
+		user.Token = &t
+		user.TokenExpiredAt = &tokenExpiredAt
+		user.UpdatedAt = &now
+
+		user, errType = s.userStorage.Update(ctx, user)
+		if errType != nil {
+			errType.Path = ".UserService->OAuthLogin()" + errType.Path
+			return nil, errType
+		}
+	}
+
+	refreshToken, errType := s.issueRefreshToken(ctx, user.ID, jti, "", "")
+	if errType != nil {
+		errType.Path = ".UserService->OAuthLogin()" + errType.Path
+		return nil, errType
+	}
+
+	return &LoginResponse{
+		SessionID:    t,
+		RefreshToken: refreshToken,
+		Claims:       tClaims,
+	}, nil
+}
+
+// findOrCreateOAuthUser links the provider identity to an existing user by
+// provider id or verified email, or creates a new passwordless User row. An
+// email the provider hasn't verified is never used to link to an existing
+// account, since anyone could claim it and take over that account.
+func (s *Service) findOrCreateOAuthUser(ctx context.Context, provider string, info *OAuthUserInfo) (*User, *types.Error) {
+	if user, err := s.userStorage.FindByProvider(ctx, provider, info.ProviderID); err == nil {
+		return user, nil
+	}
+
+	if info.Email != "" && info.EmailVerified {
+		if user, err := s.userStorage.FindByEmail(ctx, info.Email); err == nil {
+			user.Provider = provider
+			user.ProviderID = info.ProviderID
+			return s.userStorage.Update(ctx, user)
+		}
+	}
+
+	now := time.Now()
+	user := &User{
+		Name:       info.Name,
+		Email:      info.Email,
+		Provider:   provider,
+		ProviderID: info.ProviderID,
+		Password:   "",
+		RoleID:     RoleIDUser,
+		CreatedAt:  now,
+		UpdatedAt:  &now,
+	}
+
+	return s.userStorage.Insert(ctx, user)
+}
+
+// exchangeOAuthCode performs the authorization-code exchange and userinfo
+// fetch against the configured provider endpoints
+func (s *Service) exchangeOAuthCode(ctx context.Context, cfg OAuthConfig, code string) (*OAuthUserInfo, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", cfg.ClientSecret)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("code", code)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthExchangeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrOAuthExchangeFailed, resp.StatusCode)
+	}
+
+	var tokenResp oauthTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, err
+	}
+
+	return s.fetchOAuthUserInfo(ctx, cfg, tokenResp.AccessToken)
+}
+
+// fetchOAuthUserInfo calls the provider's userinfo endpoint with the access
+// token and normalizes the response into an OAuthUserInfo
+func (s *Service) fetchOAuthUserInfo(ctx context.Context, cfg OAuthConfig, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthUserInfoFailed, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrOAuthUserInfoFailed, resp.StatusCode)
+	}
+
+	var raw struct {
+		ID            string `json:"id"`
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+
+	providerID := raw.ID
+	if providerID == "" {
+		providerID = raw.Sub
+	}
+
+	return &OAuthUserInfo{
+		ProviderID:    providerID,
+		Email:         raw.Email,
+		EmailVerified: raw.EmailVerified,
+		Name:          raw.Name,
+	}, nil
+}
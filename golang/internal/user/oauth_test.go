@@ -0,0 +1,161 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newOAuthTestProvider spins up a fake token+userinfo endpoint and returns an
+// OAuthConfig pointed at it. userinfoJSON is served verbatim from /userinfo.
+func newOAuthTestProvider(t *testing.T, name string, userinfoJSON string) (OAuthConfig, func()) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(oauthTokenResponse{AccessToken: "test-access-token", TokenType: "bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(userinfoJSON))
+	})
+	srv := httptest.NewServer(mux)
+
+	cfg := OAuthConfig{
+		Name:         name,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://app.example.com/callback",
+		AuthorizeURL: srv.URL + "/authorize",
+		TokenURL:     srv.URL + "/token",
+		UserInfoURL:  srv.URL + "/userinfo",
+	}
+	return cfg, srv.Close
+}
+
+func TestOAuthLogin_CreatesNewUserWithDefaultRole(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	cfg, cleanup := newOAuthTestProvider(t, "test-provider", `{"id":"pid-1","email":"new@example.com","email_verified":true,"name":"New Person"}`)
+	defer cleanup()
+	svc.RegisterOAuthProvider(cfg)
+
+	_, state, errType := svc.BeginOAuthLogin(ctx, "test-provider")
+	if errType != nil {
+		t.Fatalf("BeginOAuthLogin: %v", errType)
+	}
+
+	resp, errType := svc.OAuthLogin(ctx, "test-provider", "auth-code", state)
+	if errType != nil {
+		t.Fatalf("OAuthLogin: %v", errType)
+	}
+	if resp.SessionID == "" {
+		t.Fatalf("expected a signed access token")
+	}
+
+	if len(storage.users) != 1 {
+		t.Fatalf("expected exactly one user to be created, got %d", len(storage.users))
+	}
+	for _, u := range storage.users {
+		if u.RoleID != RoleIDUser {
+			t.Fatalf("expected new OAuth signup to default to RoleIDUser, got %d", u.RoleID)
+		}
+		if u.ProviderID != "pid-1" {
+			t.Fatalf("expected ProviderID to be recorded, got %q", u.ProviderID)
+		}
+	}
+}
+
+func TestOAuthLogin_LinksToExistingUserByVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	existing := &User{ID: 1, Name: "Eve", Phone: "0811", Email: "eve@example.com", RoleID: RoleIDUser}
+	storage.users[existing.ID] = existing
+
+	cfg, cleanup := newOAuthTestProvider(t, "test-provider", `{"id":"pid-2","email":"eve@example.com","email_verified":true,"name":"Eve"}`)
+	defer cleanup()
+	svc.RegisterOAuthProvider(cfg)
+
+	_, state, errType := svc.BeginOAuthLogin(ctx, "test-provider")
+	if errType != nil {
+		t.Fatalf("BeginOAuthLogin: %v", errType)
+	}
+
+	if _, errType := svc.OAuthLogin(ctx, "test-provider", "auth-code", state); errType != nil {
+		t.Fatalf("OAuthLogin: %v", errType)
+	}
+
+	if len(storage.users) != 1 {
+		t.Fatalf("expected the OAuth identity to link to the existing user, got %d users", len(storage.users))
+	}
+	if storage.users[existing.ID].ProviderID != "pid-2" {
+		t.Fatalf("expected the existing user to be linked to the provider identity")
+	}
+}
+
+func TestOAuthLogin_RejectsUnverifiedEmailForLinking(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	existing := &User{ID: 1, Name: "Frank", Phone: "0812", Email: "frank@example.com", RoleID: RoleIDUser}
+	storage.users[existing.ID] = existing
+
+	cfg, cleanup := newOAuthTestProvider(t, "test-provider", `{"id":"pid-3","email":"frank@example.com","email_verified":false,"name":"Impersonator"}`)
+	defer cleanup()
+	svc.RegisterOAuthProvider(cfg)
+
+	_, state, errType := svc.BeginOAuthLogin(ctx, "test-provider")
+	if errType != nil {
+		t.Fatalf("BeginOAuthLogin: %v", errType)
+	}
+
+	if _, errType := svc.OAuthLogin(ctx, "test-provider", "auth-code", state); errType != nil {
+		t.Fatalf("OAuthLogin: %v", errType)
+	}
+
+	if len(storage.users) != 2 {
+		t.Fatalf("expected an unverified email to create a separate user instead of linking, got %d users", len(storage.users))
+	}
+	if storage.users[existing.ID].ProviderID != "" {
+		t.Fatalf("expected the existing user to remain unlinked from the provider identity")
+	}
+}
+
+func TestOAuthLogin_RejectsReusedOrUnknownState(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(false)
+
+	cfg, cleanup := newOAuthTestProvider(t, "test-provider", `{"id":"pid-4","email":"grace@example.com","email_verified":true,"name":"Grace"}`)
+	defer cleanup()
+	svc.RegisterOAuthProvider(cfg)
+
+	if _, errType := svc.OAuthLogin(ctx, "test-provider", "auth-code", "never-issued"); errType == nil {
+		t.Fatalf("expected OAuthLogin to reject a state it never issued")
+	}
+
+	_, state, errType := svc.BeginOAuthLogin(ctx, "test-provider")
+	if errType != nil {
+		t.Fatalf("BeginOAuthLogin: %v", errType)
+	}
+	if _, errType := svc.OAuthLogin(ctx, "test-provider", "auth-code", state); errType != nil {
+		t.Fatalf("OAuthLogin: %v", errType)
+	}
+	if _, errType := svc.OAuthLogin(ctx, "test-provider", "auth-code", state); errType == nil {
+		t.Fatalf("expected OAuthLogin to reject a state that was already redeemed")
+	}
+}
+
+func TestOAuthStateStore_RejectsExpiredState(t *testing.T) {
+	st := newOAuthStateStore()
+	st.items["stale-state"] = oauthStateEntry{provider: "test-provider", expiresAt: time.Now().Add(-time.Second)}
+
+	if st.redeem("test-provider", "stale-state") {
+		t.Fatalf("expected an expired state to be rejected")
+	}
+}
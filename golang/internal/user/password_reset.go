@@ -0,0 +1,226 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/riskiramdan/efishery/golang/internal/types"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordResetTTL is how long a password reset token stays valid
+const PasswordResetTTL = 30 * time.Minute
+
+// resetRateLimitWindow and resetRateLimitMax bound how often a phone number
+// can trigger RequestPasswordReset, to slow down phone enumeration
+const (
+	resetRateLimitWindow = time.Hour
+	resetRateLimitMax    = 3
+)
+
+// Errors
+var (
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrResetRateLimited   = errors.New("too many password reset requests, try again later")
+	ErrOldPasswordInvalid = errors.New("old password is incorrect")
+)
+
+// PasswordReset is a single-use, time-limited token issued to confirm a
+// password reset. Only its hash is persisted.
+type PasswordReset struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"userId" db:"userId"`
+	TokenHash string     `json:"-" db:"tokenHash"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt" db:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt" db:"createdAt"`
+}
+
+// resetRateLimiter tracks recent reset requests per phone number in memory
+type resetRateLimiter struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+}
+
+func newResetRateLimiter() *resetRateLimiter {
+	return &resetRateLimiter{hits: map[string][]time.Time{}}
+}
+
+// allow reports whether phone is still under the rate limit, recording this
+// attempt as a side effect
+func (l *resetRateLimiter) allow(phone string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-resetRateLimitWindow)
+
+	fresh := l.hits[phone][:0]
+	for _, t := range l.hits[phone] {
+		if t.After(cutoff) {
+			fresh = append(fresh, t)
+		}
+	}
+	if len(fresh) >= resetRateLimitMax {
+		l.hits[phone] = fresh
+		return false
+	}
+
+	l.hits[phone] = append(fresh, now)
+	return true
+}
+
+// RequestPasswordReset generates a reset token for the user with the given
+// phone number and dispatches it through the configured Notifier. An unknown
+// phone reports success just like a known one, so callers can't use it to
+// enumerate registered phones. It returns an error when the phone is over the
+// rate limit, or when the token can't be stored or sent.
+func (s *Service) RequestPasswordReset(ctx context.Context, phone string) *types.Error {
+	if !s.resetLimiter.allow(phone) {
+		return &types.Error{
+			Path:    ".UserService->RequestPasswordReset()",
+			Message: ErrResetRateLimited.Error(),
+			Error:   ErrResetRateLimited,
+			Type:    "validation-error",
+		}
+	}
+
+	user, err := s.userStorage.FindByPhone(ctx, phone)
+	if err != nil {
+		// Unknown phone: report success without sending anything, so this
+		// path isn't distinguishable from a known phone by the caller.
+		return nil
+	}
+
+	raw, resetErr := randomToken(32)
+	if resetErr != nil {
+		return &types.Error{
+			Path:    ".UserService->RequestPasswordReset()",
+			Message: resetErr.Error(),
+			Error:   resetErr,
+			Type:    "golang-error",
+		}
+	}
+
+	reset := &PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: time.Now().Add(PasswordResetTTL),
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.userStorage.InsertPasswordReset(ctx, reset); err != nil {
+		err.Path = ".UserService->RequestPasswordReset()" + err.Path
+		return err
+	}
+
+	if s.notifier != nil {
+		message := fmt.Sprintf("Your password reset code is %s, it expires in %d minutes.", raw, int(PasswordResetTTL.Minutes()))
+		if notifyErr := s.notifier.Notify(ctx, phone, message); notifyErr != nil {
+			return &types.Error{
+				Path:    ".UserService->RequestPasswordReset()",
+				Message: notifyErr.Error(),
+				Error:   notifyErr,
+				Type:    "golang-error",
+			}
+		}
+	}
+
+	return nil
+}
+
+// ConfirmPasswordReset validates a reset token, sets the new password, marks
+// the token used, and revokes all existing sessions for the user
+func (s *Service) ConfirmPasswordReset(ctx context.Context, token string, newPassword string) *types.Error {
+	reset, err := s.userStorage.FindPasswordResetByHash(ctx, hashRefreshToken(token))
+	if err != nil {
+		err.Path = ".UserService->ConfirmPasswordReset()" + err.Path
+		return err
+	}
+	if reset.UsedAt != nil || reset.ExpiresAt.Before(time.Now()) {
+		return &types.Error{
+			Path:    ".UserService->ConfirmPasswordReset()",
+			Message: ErrInvalidResetToken.Error(),
+			Error:   ErrInvalidResetToken,
+			Type:    "validation-error",
+		}
+	}
+
+	user, err := s.userStorage.FindByID(ctx, reset.UserID)
+	if err != nil {
+		err.Path = ".UserService->ConfirmPasswordReset()" + err.Path
+		return err
+	}
+
+	if err := s.setPassword(ctx, user, newPassword); err != nil {
+		err.Path = ".UserService->ConfirmPasswordReset()" + err.Path
+		return err
+	}
+
+	if err := s.userStorage.MarkPasswordResetUsed(ctx, reset.ID); err != nil {
+		err.Path = ".UserService->ConfirmPasswordReset()" + err.Path
+		return err
+	}
+
+	// Revoke every refresh token and cached session for the user, and clear
+	// users.token, so the old password's sessions stop working immediately.
+	if err := s.LogoutAll(ctx, user.ID); err != nil {
+		err.Path = ".UserService->ConfirmPasswordReset()" + err.Path
+		return err
+	}
+
+	return nil
+}
+
+// ChangePassword updates an authenticated user's password after verifying
+// the old one
+func (s *Service) ChangePassword(ctx context.Context, userID int, oldPassword string, newPassword string) *types.Error {
+	user, err := s.userStorage.FindByID(ctx, userID)
+	if err != nil {
+		err.Path = ".UserService->ChangePassword()" + err.Path
+		return err
+	}
+
+	if bcryptErr := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); bcryptErr != nil {
+		return &types.Error{
+			Path:    ".UserService->ChangePassword()",
+			Message: ErrOldPasswordInvalid.Error(),
+			Error:   ErrOldPasswordInvalid,
+			Type:    "validation-error",
+		}
+	}
+
+	if err := s.setPassword(ctx, user, newPassword); err != nil {
+		err.Path = ".UserService->ChangePassword()" + err.Path
+		return err
+	}
+
+	return nil
+}
+
+// setPassword bcrypts newPassword and persists it on user
+func (s *Service) setPassword(ctx context.Context, user *User, newPassword string) *types.Error {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return &types.Error{
+			Path:    ".UserService->setPassword()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "golang-error",
+		}
+	}
+
+	now := time.Now()
+	user.Password = string(bcryptHash)
+	user.UpdatedAt = &now
+
+	if _, err := s.userStorage.Update(ctx, user); err != nil {
+		err.Path = ".UserService->setPassword()" + err.Path
+		return err
+	}
+
+	return nil
+}
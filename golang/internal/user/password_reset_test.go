@@ -0,0 +1,188 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeNotifier records every message it was asked to deliver, so tests can
+// assert a reset code was (or wasn't) sent without a real SMS/email gateway
+type fakeNotifier struct {
+	sent []string
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, recipient string, message string) error {
+	n.sent = append(n.sent, recipient+": "+message)
+	return nil
+}
+
+func seedPasswordUser(storage *fakeStorage, phone string, password string) *User {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	user := &User{ID: 1, Name: "Eve", Phone: phone, Password: string(hash), RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+	return user
+}
+
+func TestRequestPasswordReset_AlwaysSucceedsAndSendsOnlyForKnownPhones(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+	notifier := &fakeNotifier{}
+	svc.notifier = notifier
+
+	seedPasswordUser(storage, "0811", "hunter2")
+
+	if errType := svc.RequestPasswordReset(ctx, "0811"); errType != nil {
+		t.Fatalf("RequestPasswordReset(known phone): %v", errType)
+	}
+	if len(notifier.sent) != 1 {
+		t.Fatalf("expected one notification for a known phone, got %d", len(notifier.sent))
+	}
+	if len(storage.resets) != 1 {
+		t.Fatalf("expected one password_resets row, got %d", len(storage.resets))
+	}
+
+	if errType := svc.RequestPasswordReset(ctx, "0000"); errType != nil {
+		t.Fatalf("RequestPasswordReset(unknown phone) should report success, got: %v", errType)
+	}
+	if len(notifier.sent) != 1 {
+		t.Fatalf("expected no notification for an unknown phone, got %d total", len(notifier.sent))
+	}
+	if len(storage.resets) != 1 {
+		t.Fatalf("expected no password_resets row for an unknown phone, got %d", len(storage.resets))
+	}
+}
+
+func TestRequestPasswordReset_RateLimitsPerPhone(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+	svc.notifier = &fakeNotifier{}
+
+	seedPasswordUser(storage, "0811", "hunter2")
+
+	for i := 0; i < resetRateLimitMax; i++ {
+		if errType := svc.RequestPasswordReset(ctx, "0811"); errType != nil {
+			t.Fatalf("request %d: %v", i, errType)
+		}
+	}
+
+	errType := svc.RequestPasswordReset(ctx, "0811")
+	if errType == nil {
+		t.Fatalf("expected the request beyond the rate limit to fail")
+	}
+	if !errors.Is(errType.Error, ErrResetRateLimited) {
+		t.Fatalf("expected ErrResetRateLimited, got %v", errType.Error)
+	}
+}
+
+func TestConfirmPasswordReset_SetsPasswordAndRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(true)
+
+	oldJWT := "old-jwt"
+	user := seedPasswordUser(storage, "0811", "old-password")
+	user.Token = &oldJWT
+
+	raw, resetErr := svc.newPasswordResetForTest(ctx, user.ID)
+	if resetErr != nil {
+		t.Fatalf("newPasswordResetForTest: %v", resetErr)
+	}
+
+	_, row, errType := svc.newRefreshToken(user.ID, "sess-1", "ua", "ip")
+	if errType != nil {
+		t.Fatalf("newRefreshToken: %v", errType)
+	}
+	if _, errType := storage.InsertRefresh(ctx, row); errType != nil {
+		t.Fatalf("InsertRefresh: %v", errType)
+	}
+	session := &Session{UserID: user.ID, RoleID: user.RoleID, ExpiresAt: time.Now().Add(time.Minute)}
+	if err := svc.sessionStore.Put(ctx, "sess-1", session, time.Minute); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if errType := svc.ConfirmPasswordReset(ctx, raw, "new-password"); errType != nil {
+		t.Fatalf("ConfirmPasswordReset: %v", errType)
+	}
+
+	stored := storage.users[user.ID]
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("new-password")) != nil {
+		t.Fatalf("expected the new password to be set")
+	}
+	if stored.Token != nil {
+		t.Fatalf("expected users.token to be cleared, got %v", *stored.Token)
+	}
+	if row.RevokedAt == nil {
+		t.Fatalf("expected the user's refresh token to be revoked")
+	}
+	if _, err := svc.sessionStore.Get(ctx, "sess-1"); err == nil {
+		t.Fatalf("expected the user's cached session to be evicted")
+	}
+
+	if errType := svc.ConfirmPasswordReset(ctx, raw, "another-password"); errType == nil {
+		t.Fatalf("expected a used reset token to be rejected")
+	}
+}
+
+func TestConfirmPasswordReset_RejectsExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := seedPasswordUser(storage, "0811", "old-password")
+
+	raw, resetErr := randomToken(32)
+	if resetErr != nil {
+		t.Fatalf("randomToken: %v", resetErr)
+	}
+	reset := &PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: time.Now().Add(-time.Minute),
+		CreatedAt: time.Now(),
+	}
+	if _, errType := storage.InsertPasswordReset(ctx, reset); errType != nil {
+		t.Fatalf("InsertPasswordReset: %v", errType)
+	}
+
+	if errType := svc.ConfirmPasswordReset(ctx, raw, "new-password"); errType == nil {
+		t.Fatalf("expected an expired reset token to be rejected")
+	}
+}
+
+func TestChangePassword_RequiresCorrectOldPassword(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+	user := seedPasswordUser(storage, "0811", "old-password")
+
+	if errType := svc.ChangePassword(ctx, user.ID, "wrong-password", "new-password"); errType == nil {
+		t.Fatalf("expected ChangePassword to reject the wrong old password")
+	}
+
+	if errType := svc.ChangePassword(ctx, user.ID, "old-password", "new-password"); errType != nil {
+		t.Fatalf("ChangePassword: %v", errType)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(storage.users[user.ID].Password), []byte("new-password")) != nil {
+		t.Fatalf("expected the new password to be set")
+	}
+}
+
+// newPasswordResetForTest mirrors RequestPasswordReset's token generation
+// without the rate limiter or notifier, returning the raw token
+func (s *Service) newPasswordResetForTest(ctx context.Context, userID int) (string, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	reset := &PasswordReset{
+		UserID:    userID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: time.Now().Add(PasswordResetTTL),
+		CreatedAt: time.Now(),
+	}
+	if _, errType := s.userStorage.InsertPasswordReset(ctx, reset); errType != nil {
+		return "", errType.Error
+	}
+	return raw, nil
+}
@@ -0,0 +1,153 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/riskiramdan/efishery/golang/internal/types"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Permission is a single grantable action, e.g. "user:write"
+type Permission = string
+
+// Permissions eFishery currently guards behind RBAC
+const (
+	PermissionUserRead   Permission = "user:read"
+	PermissionUserWrite  Permission = "user:write"
+	PermissionPriceRead  Permission = "price:read"
+	PermissionPriceWrite Permission = "price:write"
+)
+
+// Role groups a set of permissions under a name that can be assigned to a User
+type Role struct {
+	ID          int      `json:"id" db:"id"`
+	Name        string   `json:"name" db:"name"`
+	Permissions []string `json:"permissions" db:"permissions"`
+}
+
+// eFishery's default role IDs, matching the RoleID already stored on User
+const (
+	RoleIDAdmin     = 1
+	RoleIDUser      = 2
+	RoleIDFreelance = 3
+)
+
+// DefaultRoles seeds the three roles eFishery has always distinguished by
+// RoleID, now backed by an actual permission list instead of ad-hoc checks
+func DefaultRoles() []*Role {
+	return []*Role{
+		{
+			ID:   RoleIDAdmin,
+			Name: "admin",
+			Permissions: []string{
+				PermissionUserRead, PermissionUserWrite,
+				PermissionPriceRead, PermissionPriceWrite,
+			},
+		},
+		{
+			ID:   RoleIDUser,
+			Name: "user",
+			Permissions: []string{
+				PermissionUserRead,
+				PermissionPriceRead,
+			},
+		},
+		{
+			ID:   RoleIDFreelance,
+			Name: "freelance",
+			Permissions: []string{
+				PermissionUserRead,
+				PermissionPriceRead, PermissionPriceWrite,
+			},
+		},
+	}
+}
+
+// Errors
+var (
+	ErrMissingPermission = errors.New("missing required permission")
+)
+
+// Authorize verifies tokenString and checks that its "perms" claim grants
+// every permission in perms
+func (s *Service) Authorize(ctx context.Context, tokenString string, perms ...string) *types.Error {
+	claims, errType := s.VerifyTokenJWT(ctx, tokenString)
+	if errType != nil {
+		errType.Path = ".UserService->Authorize()" + errType.Path
+		return errType
+	}
+
+	granted := permissionSet(claims)
+	for _, p := range perms {
+		if !granted[p] {
+			return &types.Error{
+				Path:    ".UserService->Authorize()",
+				Message: ErrMissingPermission.Error(),
+				Error:   ErrMissingPermission,
+				Type:    "forbidden-error",
+			}
+		}
+	}
+
+	return nil
+}
+
+// permissionSet extracts the "perms" claim from a parsed JWT's claims into a
+// set for quick lookup
+func permissionSet(claims interface{}) map[string]bool {
+	set := map[string]bool{}
+
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return set
+	}
+
+	switch perms := mapClaims["perms"].(type) {
+	case []string:
+		for _, p := range perms {
+			set[p] = true
+		}
+	case []interface{}:
+		for _, p := range perms {
+			if s, ok := p.(string); ok {
+				set[s] = true
+			}
+		}
+	}
+
+	return set
+}
+
+// RequirePermission returns net/http middleware that authorizes the
+// Authorization: Bearer <token> header against perms before calling next
+func RequirePermission(svc ServiceInterface, perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				http.Error(w, "missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			if err := svc.Authorize(r.Context(), token, perms...); err != nil {
+				http.Error(w, err.Message, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bearerToken extracts the token from a "Bearer <token>" Authorization header
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+		return ""
+	}
+	return header[len(prefix):]
+}
@@ -0,0 +1,111 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorize_GrantsWhenPermissionPresent(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Alice", Phone: "0811", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+	storage.perms[user.ID] = []string{PermissionUserRead}
+
+	token, _, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+
+	if errType := svc.Authorize(ctx, token, PermissionUserRead); errType != nil {
+		t.Fatalf("Authorize: %v", errType)
+	}
+}
+
+func TestAuthorize_RejectsMissingPermission(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Bob", Phone: "0812", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+	storage.perms[user.ID] = []string{PermissionUserRead}
+
+	token, _, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+
+	errType = svc.Authorize(ctx, token, PermissionUserWrite)
+	if errType == nil {
+		t.Fatalf("expected Authorize to reject a missing permission")
+	}
+	if errType.Type != "forbidden-error" {
+		t.Fatalf("expected a forbidden-error, got %q", errType.Type)
+	}
+}
+
+func TestRequirePermission_Middleware(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Carol", Phone: "0813", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+	storage.perms[user.ID] = []string{PermissionUserRead}
+
+	token, _, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequirePermission(svc, PermissionUserRead)(next)
+
+	t.Run("missing bearer token", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+		if called {
+			t.Fatalf("expected next handler not to be called")
+		}
+	})
+
+	t.Run("granted permission", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if !called {
+			t.Fatalf("expected next handler to be called")
+		}
+	})
+
+	writeHandler := RequirePermission(svc, PermissionUserWrite)(next)
+	t.Run("missing permission", func(t *testing.T) {
+		called = false
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		writeHandler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", rec.Code)
+		}
+		if called {
+			t.Fatalf("expected next handler not to be called")
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/riskiramdan/efishery/golang/internal/constants"
+	"github.com/riskiramdan/efishery/golang/internal/types"
+)
+
+// Errors
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+)
+
+// RefreshToken is an opaque, long-lived credential that can be exchanged for
+// a new access+refresh pair. Only its hash is persisted.
+type RefreshToken struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"userId" db:"userId"`
+	TokenHash  string     `json:"-" db:"tokenHash"`
+	SessionID  string     `json:"-" db:"sessionId"`
+	ExpiresAt  time.Time  `json:"expiresAt" db:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt" db:"revokedAt"`
+	ReplacedBy *int       `json:"replacedBy" db:"replacedBy"`
+	UserAgent  string     `json:"userAgent" db:"userAgent"`
+	IP         string     `json:"ip" db:"ip"`
+	CreatedAt  time.Time  `json:"createdAt" db:"createdAt"`
+}
+
+// Refresh validates a refresh token, rotates it (revoking the old row and
+// inserting its replacement), and returns a new access+refresh pair
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*LoginResponse, *types.Error) {
+	hash := hashRefreshToken(refreshToken)
+
+	row, err := s.userStorage.FindRefreshByHash(ctx, hash)
+	if err != nil {
+		err.Path = ".UserService->Refresh()" + err.Path
+		return nil, err
+	}
+	if row.RevokedAt != nil || row.ExpiresAt.Before(time.Now()) {
+		return nil, &types.Error{
+			Path:    ".UserService->Refresh()",
+			Message: ErrInvalidRefreshToken.Error(),
+			Error:   ErrInvalidRefreshToken,
+			Type:    "validation-error",
+		}
+	}
+
+	user, err := s.userStorage.FindByID(ctx, row.UserID)
+	if err != nil {
+		err.Path = ".UserService->Refresh()" + err.Path
+		return nil, err
+	}
+
+	t, tClaims, tokenExpiredAt, errType := s.issueToken(ctx, user)
+	if errType != nil {
+		errType.Path = ".UserService->Refresh()" + errType.Path
+		return nil, errType
+	}
+	jti, _ := tClaims["jti"].(string)
+
+	if s.persistToken {
+		now := time.Now()
+		user.Token = &t
+		user.TokenExpiredAt = &tokenExpiredAt
+		user.UpdatedAt = &now
+		if _, err := s.userStorage.Update(ctx, user); err != nil {
+			err.Path = ".UserService->Refresh()" + err.Path
+			return nil, err
+		}
+	}
+
+	newRefreshToken, newRow, errType := s.newRefreshToken(user.ID, jti, row.UserAgent, row.IP)
+	if errType != nil {
+		errType.Path = ".UserService->Refresh()" + errType.Path
+		return nil, errType
+	}
+	newRow, errType = s.userStorage.InsertRefresh(ctx, newRow)
+	if errType != nil {
+		errType.Path = ".UserService->Refresh()" + errType.Path
+		return nil, errType
+	}
+	if err := s.userStorage.RevokeRefresh(ctx, row.ID, &newRow.ID); err != nil {
+		err.Path = ".UserService->Refresh()" + err.Path
+		return nil, err
+	}
+	_ = s.sessionStore.Delete(ctx, row.SessionID)
+
+	return &LoginResponse{
+		SessionID:    t,
+		RefreshToken: newRefreshToken,
+		Claims:       tClaims,
+	}, nil
+}
+
+// Logout revokes a single refresh token, ending that session
+func (s *Service) Logout(ctx context.Context, userID int, refreshToken string) *types.Error {
+	hash := hashRefreshToken(refreshToken)
+
+	row, err := s.userStorage.FindRefreshByHash(ctx, hash)
+	if err != nil {
+		err.Path = ".UserService->Logout()" + err.Path
+		return err
+	}
+	if row.UserID != userID {
+		return &types.Error{
+			Path:    ".UserService->Logout()",
+			Message: ErrInvalidRefreshToken.Error(),
+			Error:   ErrInvalidRefreshToken,
+			Type:    "validation-error",
+		}
+	}
+
+	if err := s.userStorage.RevokeRefresh(ctx, row.ID, nil); err != nil {
+		err.Path = ".UserService->Logout()" + err.Path
+		return err
+	}
+	_ = s.sessionStore.Delete(ctx, row.SessionID)
+
+	if err := s.clearPersistedToken(ctx, userID); err != nil {
+		err.Path = ".UserService->Logout()" + err.Path
+		return err
+	}
+
+	return nil
+}
+
+// LogoutAll revokes every refresh token belonging to a user and evicts their
+// cached sessions, ending all of their sessions immediately rather than
+// waiting for each access token's exp
+func (s *Service) LogoutAll(ctx context.Context, userID int) *types.Error {
+	sessionIDs, err := s.userStorage.ListActiveSessionIDsForUser(ctx, userID)
+	if err != nil {
+		err.Path = ".UserService->LogoutAll()" + err.Path
+		return err
+	}
+
+	if err := s.userStorage.RevokeAllForUser(ctx, userID); err != nil {
+		err.Path = ".UserService->LogoutAll()" + err.Path
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		_ = s.sessionStore.Delete(ctx, sessionID)
+	}
+
+	if err := s.clearPersistedToken(ctx, userID); err != nil {
+		err.Path = ".UserService->LogoutAll()" + err.Path
+		return err
+	}
+
+	return nil
+}
+
+// clearPersistedToken nulls out a user's users.token/tokenExpiredAt row when
+// persistToken is enabled, so a revoked session can't keep authenticating
+// through VerifyTokenJWT's Postgres fallback until the JWT's exp
+func (s *Service) clearPersistedToken(ctx context.Context, userID int) *types.Error {
+	if !s.persistToken {
+		return nil
+	}
+
+	user, err := s.userStorage.FindByID(ctx, userID)
+	if err != nil {
+		err.Path = ".UserService->clearPersistedToken()" + err.Path
+		return err
+	}
+
+	now := time.Now()
+	user.Token = nil
+	user.TokenExpiredAt = nil
+	user.UpdatedAt = &now
+
+	if _, err := s.userStorage.Update(ctx, user); err != nil {
+		err.Path = ".UserService->clearPersistedToken()" + err.Path
+		return err
+	}
+
+	return nil
+}
+
+// CleanExpiredRefreshTokens deletes refresh token rows past their expiry,
+// meant to be run periodically by a background cleaner
+func (s *Service) CleanExpiredRefreshTokens(ctx context.Context) *types.Error {
+	if err := s.userStorage.DeleteExpiredRefresh(ctx); err != nil {
+		err.Path = ".UserService->CleanExpiredRefreshTokens()" + err.Path
+		return err
+	}
+	return nil
+}
+
+// StartRefreshCleaner runs CleanExpiredRefreshTokens on the given interval
+// until ctx is cancelled
+func (s *Service) StartRefreshCleaner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = s.CleanExpiredRefreshTokens(ctx)
+			}
+		}
+	}()
+}
+
+// issueRefreshToken creates, persists, and returns a new opaque refresh
+// token for a user, paired with the access token identified by sessionID
+func (s *Service) issueRefreshToken(ctx context.Context, userID int, sessionID string, userAgent string, ip string) (string, *types.Error) {
+	raw, row, errType := s.newRefreshToken(userID, sessionID, userAgent, ip)
+	if errType != nil {
+		return "", errType
+	}
+	if _, errType := s.userStorage.InsertRefresh(ctx, row); errType != nil {
+		return "", errType
+	}
+	return raw, nil
+}
+
+// newRefreshToken generates a random refresh token and the storage row that
+// will hold its hash, without persisting it
+func (s *Service) newRefreshToken(userID int, sessionID string, userAgent string, ip string) (string, *RefreshToken, *types.Error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", nil, &types.Error{
+			Path:    ".UserService->newRefreshToken()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "golang-error",
+		}
+	}
+
+	row := &RefreshToken{
+		UserID:    userID,
+		TokenHash: hashRefreshToken(raw),
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(constants.RefreshExpireTime),
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: time.Now(),
+	}
+
+	return raw, row, nil
+}
+
+// randomToken returns a base64url-encoded string of n cryptographically
+// random bytes
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken returns the hex-less base64url SHA-256 hash of a raw
+// refresh token, which is what gets persisted and looked up
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
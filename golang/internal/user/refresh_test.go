@@ -0,0 +1,360 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riskiramdan/efishery/golang/internal/types"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// fakeStorage is an in-memory Storage used by this package's tests
+type fakeStorage struct {
+	users         map[int]*User
+	nextUserID    int
+	refresh       map[int]*RefreshToken
+	nextRefreshID int
+	resets        map[int]*PasswordReset
+	nextResetID   int
+	roles         map[int]*Role
+	perms         map[int][]string
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		users:   map[int]*User{},
+		refresh: map[int]*RefreshToken{},
+		resets:  map[int]*PasswordReset{},
+		roles:   map[int]*Role{},
+		perms:   map[int][]string{},
+	}
+}
+
+func notFoundError(path string) *types.Error {
+	return &types.Error{Path: path, Message: "not found", Type: "not-found-error"}
+}
+
+func (f *fakeStorage) FindAll(ctx context.Context, params *FindAllUsersParams) ([]*User, *types.Error) {
+	var out []*User
+	for _, u := range f.users {
+		if params.Phone != "" && u.Phone != params.Phone {
+			continue
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+func (f *fakeStorage) FindByID(ctx context.Context, userID int) (*User, *types.Error) {
+	if u, ok := f.users[userID]; ok {
+		return u, nil
+	}
+	return nil, notFoundError(".fakeStorage->FindByID()")
+}
+
+func (f *fakeStorage) FindByPhone(ctx context.Context, phone string) (*User, *types.Error) {
+	for _, u := range f.users {
+		if u.Phone == phone {
+			return u, nil
+		}
+	}
+	return nil, notFoundError(".fakeStorage->FindByPhone()")
+}
+
+func (f *fakeStorage) FindByToken(ctx context.Context, token string) (*User, *types.Error) {
+	for _, u := range f.users {
+		if u.Token != nil && *u.Token == token {
+			return u, nil
+		}
+	}
+	return nil, notFoundError(".fakeStorage->FindByToken()")
+}
+
+func (f *fakeStorage) FindByProvider(ctx context.Context, provider string, providerID string) (*User, *types.Error) {
+	for _, u := range f.users {
+		if u.Provider == provider && u.ProviderID == providerID {
+			return u, nil
+		}
+	}
+	return nil, notFoundError(".fakeStorage->FindByProvider()")
+}
+
+func (f *fakeStorage) FindByEmail(ctx context.Context, email string) (*User, *types.Error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, notFoundError(".fakeStorage->FindByEmail()")
+}
+
+func (f *fakeStorage) Insert(ctx context.Context, user *User) (*User, *types.Error) {
+	f.nextUserID++
+	for f.users[f.nextUserID] != nil {
+		f.nextUserID++
+	}
+	user.ID = f.nextUserID
+	f.users[user.ID] = user
+	return user, nil
+}
+
+func (f *fakeStorage) Update(ctx context.Context, user *User) (*User, *types.Error) {
+	if _, ok := f.users[user.ID]; !ok {
+		return nil, notFoundError(".fakeStorage->Update()")
+	}
+	f.users[user.ID] = user
+	return user, nil
+}
+
+func (f *fakeStorage) Delete(ctx context.Context, userID int) *types.Error {
+	delete(f.users, userID)
+	return nil
+}
+
+func (f *fakeStorage) InsertRefresh(ctx context.Context, refresh *RefreshToken) (*RefreshToken, *types.Error) {
+	f.nextRefreshID++
+	refresh.ID = f.nextRefreshID
+	f.refresh[refresh.ID] = refresh
+	return refresh, nil
+}
+
+func (f *fakeStorage) FindRefreshByHash(ctx context.Context, tokenHash string) (*RefreshToken, *types.Error) {
+	for _, r := range f.refresh {
+		if r.TokenHash == tokenHash {
+			return r, nil
+		}
+	}
+	return nil, notFoundError(".fakeStorage->FindRefreshByHash()")
+}
+
+func (f *fakeStorage) RevokeRefresh(ctx context.Context, id int, replacedBy *int) *types.Error {
+	r, ok := f.refresh[id]
+	if !ok {
+		return notFoundError(".fakeStorage->RevokeRefresh()")
+	}
+	now := time.Now()
+	r.RevokedAt = &now
+	r.ReplacedBy = replacedBy
+	return nil
+}
+
+func (f *fakeStorage) RevokeAllForUser(ctx context.Context, userID int) *types.Error {
+	now := time.Now()
+	for _, r := range f.refresh {
+		if r.UserID == userID && r.RevokedAt == nil {
+			r.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (f *fakeStorage) DeleteExpiredRefresh(ctx context.Context) *types.Error {
+	now := time.Now()
+	for id, r := range f.refresh {
+		if r.ExpiresAt.Before(now) {
+			delete(f.refresh, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStorage) InsertPasswordReset(ctx context.Context, reset *PasswordReset) (*PasswordReset, *types.Error) {
+	f.nextResetID++
+	reset.ID = f.nextResetID
+	f.resets[reset.ID] = reset
+	return reset, nil
+}
+
+func (f *fakeStorage) FindPasswordResetByHash(ctx context.Context, tokenHash string) (*PasswordReset, *types.Error) {
+	for _, r := range f.resets {
+		if r.TokenHash == tokenHash {
+			return r, nil
+		}
+	}
+	return nil, notFoundError(".fakeStorage->FindPasswordResetByHash()")
+}
+
+func (f *fakeStorage) MarkPasswordResetUsed(ctx context.Context, id int) *types.Error {
+	r, ok := f.resets[id]
+	if !ok {
+		return notFoundError(".fakeStorage->MarkPasswordResetUsed()")
+	}
+	now := time.Now()
+	r.UsedAt = &now
+	return nil
+}
+
+func (f *fakeStorage) FindRoleByID(ctx context.Context, roleID int) (*Role, *types.Error) {
+	if r, ok := f.roles[roleID]; ok {
+		return r, nil
+	}
+	return nil, notFoundError(".fakeStorage->FindRoleByID()")
+}
+
+func (f *fakeStorage) ListPermissionsForUser(ctx context.Context, userID int) ([]string, *types.Error) {
+	return f.perms[userID], nil
+}
+
+func (f *fakeStorage) ListActiveSessionIDsForUser(ctx context.Context, userID int) ([]string, *types.Error) {
+	var sessionIDs []string
+	for _, r := range f.refresh {
+		if r.UserID == userID && r.RevokedAt == nil {
+			sessionIDs = append(sessionIDs, r.SessionID)
+		}
+	}
+	return sessionIDs, nil
+}
+
+// newTestService builds a Service wired to a fakeStorage and a real
+// MemorySessionStore, suitable for exercising Refresh/Logout/GetByToken
+// without a database or Redis
+func newTestService(persistToken bool) (*Service, *fakeStorage) {
+	storage := newFakeStorage()
+	keyring := NewKeyring(&KeyEntry{
+		KeyID:     "test-kid",
+		Method:    jwt.SigningMethodHS256,
+		SecretKey: []byte("test-secret"),
+	})
+	tokenConfig := TokenConfig{
+		AccessTTL: time.Minute,
+		Issuer:    "efishery-test",
+	}
+	svc := NewService(storage, nil, tokenConfig, keyring, NewMemorySessionStore(), persistToken)
+	return svc, storage
+}
+
+func TestRefresh_RotatesTokenAndRevokesOldRow(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Alice", Phone: "0811", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	raw, row, errType := svc.newRefreshToken(user.ID, "sess-1", "ua", "ip")
+	if errType != nil {
+		t.Fatalf("newRefreshToken: %v", errType)
+	}
+	if _, errType := storage.InsertRefresh(ctx, row); errType != nil {
+		t.Fatalf("InsertRefresh: %v", errType)
+	}
+
+	resp, errType := svc.Refresh(ctx, raw)
+	if errType != nil {
+		t.Fatalf("Refresh: %v", errType)
+	}
+	if resp.RefreshToken == raw {
+		t.Fatalf("expected a rotated refresh token, got the same one back")
+	}
+
+	if row.RevokedAt == nil {
+		t.Fatalf("expected old refresh row to be revoked")
+	}
+	if row.ReplacedBy == nil {
+		t.Fatalf("expected old refresh row to record its replacement")
+	}
+
+	if _, errType := svc.Refresh(ctx, raw); errType == nil {
+		t.Fatalf("expected the revoked refresh token to no longer work")
+	}
+}
+
+func TestLogout_RevokesTokenAndClearsPersistedToken(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(true)
+
+	oldJWT := "old-jwt"
+	user := &User{ID: 1, Name: "Bob", Phone: "0812", RoleID: RoleIDUser, Token: &oldJWT}
+	storage.users[user.ID] = user
+
+	raw, row, errType := svc.newRefreshToken(user.ID, "sess-2", "ua", "ip")
+	if errType != nil {
+		t.Fatalf("newRefreshToken: %v", errType)
+	}
+	if _, errType := storage.InsertRefresh(ctx, row); errType != nil {
+		t.Fatalf("InsertRefresh: %v", errType)
+	}
+	session := &Session{UserID: user.ID, RoleID: user.RoleID, ExpiresAt: time.Now().Add(time.Minute)}
+	if err := svc.sessionStore.Put(ctx, "sess-2", session, time.Minute); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if errType := svc.Logout(ctx, user.ID, raw); errType != nil {
+		t.Fatalf("Logout: %v", errType)
+	}
+
+	if row.RevokedAt == nil {
+		t.Fatalf("expected refresh row to be revoked")
+	}
+	if _, err := svc.sessionStore.Get(ctx, "sess-2"); err == nil {
+		t.Fatalf("expected cached session to be evicted")
+	}
+	if storage.users[user.ID].Token != nil {
+		t.Fatalf("expected users.token to be cleared, got %v", *storage.users[user.ID].Token)
+	}
+}
+
+func TestLogout_RejectsRefreshTokenBelongingToAnotherUser(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Carol", Phone: "0813", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	raw, row, errType := svc.newRefreshToken(user.ID, "sess-3", "ua", "ip")
+	if errType != nil {
+		t.Fatalf("newRefreshToken: %v", errType)
+	}
+	if _, errType := storage.InsertRefresh(ctx, row); errType != nil {
+		t.Fatalf("InsertRefresh: %v", errType)
+	}
+
+	if errType := svc.Logout(ctx, user.ID+1, raw); errType == nil {
+		t.Fatalf("expected Logout to reject a refresh token belonging to a different user")
+	}
+	if row.RevokedAt != nil {
+		t.Fatalf("refresh row should not have been revoked")
+	}
+}
+
+func TestLogoutAll_RevokesEverySessionAndClearsPersistedToken(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(true)
+
+	oldJWT := "old-jwt"
+	user := &User{ID: 1, Name: "Dana", Phone: "0814", RoleID: RoleIDUser, Token: &oldJWT}
+	storage.users[user.ID] = user
+
+	for _, sessionID := range []string{"sess-a", "sess-b"} {
+		_, row, errType := svc.newRefreshToken(user.ID, sessionID, "ua", "ip")
+		if errType != nil {
+			t.Fatalf("newRefreshToken: %v", errType)
+		}
+		if _, errType := storage.InsertRefresh(ctx, row); errType != nil {
+			t.Fatalf("InsertRefresh: %v", errType)
+		}
+		session := &Session{UserID: user.ID, RoleID: user.RoleID, ExpiresAt: time.Now().Add(time.Minute)}
+		if err := svc.sessionStore.Put(ctx, sessionID, session, time.Minute); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	if errType := svc.LogoutAll(ctx, user.ID); errType != nil {
+		t.Fatalf("LogoutAll: %v", errType)
+	}
+
+	for _, r := range storage.refresh {
+		if r.RevokedAt == nil {
+			t.Fatalf("expected every refresh row to be revoked")
+		}
+	}
+	for _, sessionID := range []string{"sess-a", "sess-b"} {
+		if _, err := svc.sessionStore.Get(ctx, sessionID); err == nil {
+			t.Fatalf("expected cached session %q to be evicted", sessionID)
+		}
+	}
+	if storage.users[user.ID].Token != nil {
+		t.Fatalf("expected users.token to be cleared, got %v", *storage.users[user.ID].Token)
+	}
+}
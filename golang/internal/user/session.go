@@ -0,0 +1,129 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// ErrSessionNotFound is returned by a SessionStore when a token/jti has no
+// cached session, either because it never had one or it was deleted
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is the cached, denormalized view of an access token's subject,
+// keyed by the token's "jti" so it can be looked up without hitting Postgres
+type Session struct {
+	UserID      int       `json:"userId"`
+	RoleID      int       `json:"roleId"`
+	Permissions []string  `json:"permissions"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// SessionStore is a fast, TTL'd lookup for access token sessions, consulted
+// by VerifyTokenJWT/GetByToken before falling back to Postgres
+type SessionStore interface {
+	Get(ctx context.Context, jti string) (*Session, error)
+	Put(ctx context.Context, jti string, session *Session, ttl time.Duration) error
+	Delete(ctx context.Context, jti string) error
+}
+
+// MemorySessionStore is the default in-process SessionStore, suitable for a
+// single instance or for tests
+type MemorySessionStore struct {
+	mu    sync.RWMutex
+	items map[string]memorySessionItem
+}
+
+type memorySessionItem struct {
+	session   *Session
+	expiresAt time.Time
+}
+
+// NewMemorySessionStore creates an empty in-memory SessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{items: map[string]memorySessionItem{}}
+}
+
+// Get returns the cached session for jti, or ErrSessionNotFound if it is
+// missing or has expired
+func (m *MemorySessionStore) Get(ctx context.Context, jti string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	item, ok := m.items[jti]
+	if !ok || item.expiresAt.Before(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+	return item.session, nil
+}
+
+// Put caches session under jti for ttl
+func (m *MemorySessionStore) Put(ctx context.Context, jti string, session *Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[jti] = memorySessionItem{session: session, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete removes the cached session for jti, if any
+func (m *MemorySessionStore) Delete(ctx context.Context, jti string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.items, jti)
+	return nil
+}
+
+// RedisSessionStore is a SessionStore backed by Redis or a Valkey instance
+// speaking the Redis protocol
+type RedisSessionStore struct {
+	client    *goredis.Client
+	keyPrefix string
+}
+
+// NewRedisSessionStore creates a SessionStore backed by client. keyPrefix is
+// prepended to every jti to namespace keys, e.g. "efishery:session:"
+func NewRedisSessionStore(client *goredis.Client, keyPrefix string) *RedisSessionStore {
+	return &RedisSessionStore{client: client, keyPrefix: keyPrefix}
+}
+
+func (r *RedisSessionStore) key(jti string) string {
+	return r.keyPrefix + jti
+}
+
+// Get returns the cached session for jti, or ErrSessionNotFound if it is
+// missing or has expired
+func (r *RedisSessionStore) Get(ctx context.Context, jti string) (*Session, error) {
+	raw, err := r.client.Get(ctx, r.key(jti)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Put caches session under jti for ttl
+func (r *RedisSessionStore) Put(ctx context.Context, jti string, session *Session, ttl time.Duration) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.key(jti), raw, ttl).Err()
+}
+
+// Delete removes the cached session for jti, if any
+func (r *RedisSessionStore) Delete(ctx context.Context, jti string) error {
+	return r.client.Del(ctx, r.key(jti)).Err()
+}
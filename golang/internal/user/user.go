@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/riskiramdan/efishery/golang/internal/constants"
 	"github.com/riskiramdan/efishery/golang/internal/types"
 
 	"github.com/dgrijalva/jwt-go"
@@ -26,7 +25,10 @@ type User struct {
 	RoleID         int        `json:"roleId" db:"roleId"`
 	Name           string     `json:"name" db:"name"`
 	Phone          string     `json:"phone" db:"phone"`
+	Email          string     `json:"email" db:"email"`
 	Password       string     `json:"password" db:"password"`
+	Provider       string     `json:"provider" db:"provider"`
+	ProviderID     string     `json:"providerId" db:"providerId"`
 	Token          *string    `json:"token" db:"token"`
 	TokenExpiredAt *time.Time `json:"tokenExpiredAt" db:"tokenExpiredAt"`
 	CreatedAt      time.Time  `json:"createdAt" db:"createdAt"`
@@ -59,8 +61,9 @@ type LoginParams struct {
 
 // LoginResponse represents the response of login function
 type LoginResponse struct {
-	SessionID string      `json:"sessionId"`
-	Claims    interface{} `json:"claims"`
+	SessionID    string      `json:"sessionId"`
+	RefreshToken string      `json:"refreshToken"`
+	Claims       interface{} `json:"claims"`
 }
 
 // VerifyParams  ..
@@ -74,9 +77,22 @@ type Storage interface {
 	FindByID(ctx context.Context, userID int) (*User, *types.Error)
 	FindByPhone(ctx context.Context, phone string) (*User, *types.Error)
 	FindByToken(ctx context.Context, token string) (*User, *types.Error)
+	FindByProvider(ctx context.Context, provider string, providerID string) (*User, *types.Error)
+	FindByEmail(ctx context.Context, email string) (*User, *types.Error)
 	Insert(ctx context.Context, user *User) (*User, *types.Error)
 	Update(ctx context.Context, user *User) (*User, *types.Error)
 	Delete(ctx context.Context, userID int) *types.Error
+	InsertRefresh(ctx context.Context, refresh *RefreshToken) (*RefreshToken, *types.Error)
+	FindRefreshByHash(ctx context.Context, tokenHash string) (*RefreshToken, *types.Error)
+	RevokeRefresh(ctx context.Context, id int, replacedBy *int) *types.Error
+	RevokeAllForUser(ctx context.Context, userID int) *types.Error
+	DeleteExpiredRefresh(ctx context.Context) *types.Error
+	InsertPasswordReset(ctx context.Context, reset *PasswordReset) (*PasswordReset, *types.Error)
+	FindPasswordResetByHash(ctx context.Context, tokenHash string) (*PasswordReset, *types.Error)
+	MarkPasswordResetUsed(ctx context.Context, id int) *types.Error
+	FindRoleByID(ctx context.Context, roleID int) (*Role, *types.Error)
+	ListPermissionsForUser(ctx context.Context, userID int) ([]string, *types.Error)
+	ListActiveSessionIDsForUser(ctx context.Context, userID int) ([]string, *types.Error)
 }
 
 // ServiceInterface represents the user service interface
@@ -85,13 +101,30 @@ type ServiceInterface interface {
 	GetUser(ctx context.Context, userID int) (*User, *types.Error)
 	CreateUser(ctx context.Context, params *TransactionParams) (*User, *types.Error)
 	Login(ctx context.Context, phone string, password string) (*LoginResponse, *types.Error)
+	BeginOAuthLogin(ctx context.Context, provider string) (string, string, *types.Error)
+	OAuthLogin(ctx context.Context, provider string, code string, state string) (*LoginResponse, *types.Error)
+	Refresh(ctx context.Context, refreshToken string) (*LoginResponse, *types.Error)
+	Logout(ctx context.Context, userID int, refreshToken string) *types.Error
+	LogoutAll(ctx context.Context, userID int) *types.Error
+	RequestPasswordReset(ctx context.Context, phone string) *types.Error
+	ConfirmPasswordReset(ctx context.Context, token string, newPassword string) *types.Error
+	ChangePassword(ctx context.Context, userID int, oldPassword string, newPassword string) *types.Error
+	Authorize(ctx context.Context, tokenString string, perms ...string) *types.Error
 	GetByToken(ctx context.Context, token string) (*User, *types.Error)
 	VerifyTokenJWT(ctx context.Context, tokenString string) (interface{}, *types.Error)
 }
 
 // Service is the domain logic implementation of user Service interface
 type Service struct {
-	userStorage Storage
+	userStorage    Storage
+	oauthProviders map[string]OAuthConfig
+	oauthStates    *oauthStateStore
+	notifier       Notifier
+	resetLimiter   *resetRateLimiter
+	tokenConfig    TokenConfig
+	keyring        *Keyring
+	sessionStore   SessionStore
+	persistToken   bool
 }
 
 // ListUsers is listing users
@@ -141,6 +174,11 @@ func (s *Service) CreateUser(ctx context.Context, params *TransactionParams) (*U
 		}
 	}
 
+	if _, errType := s.userStorage.FindRoleByID(ctx, params.RoleID); errType != nil {
+		errType.Path = ".UserService->CreateUser()" + errType.Path
+		return nil, errType
+	}
+
 	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, &types.Error{
@@ -196,49 +234,131 @@ func (s *Service) Login(ctx context.Context, phone string, password string) (*Lo
 	errBcrypt := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if errBcrypt != nil {
 		return nil, &types.Error{
-			Path:    ".UserService->ChangePassword()",
+			Path:    ".UserService->Login()",
 			Message: ErrWrongPassword.Error(),
 			Error:   ErrWrongPassword,
 			Type:    "golang-error",
 		}
 	}
 
-	now := time.Now()
-	tokenExpiredAt := time.Now().Add(constants.ExpireTime)
+	t, tClaims, tokenExpiredAt, errType := s.issueToken(ctx, user)
+	if errType != nil {
+		errType.Path = ".UserService->Login()" + errType.Path
+		return nil, errType
+	}
+	jti, _ := tClaims["jti"].(string)
+
+	if s.persistToken {
+		now := time.Now()
+		user.Token = &t
+		user.TokenExpiredAt = &tokenExpiredAt
+		user.UpdatedAt = &now
+
+		user, err = s.userStorage.Update(ctx, user)
+		if err != nil {
+			err.Path = ".UserService->Login()" + err.Path
+			return nil, err
+		}
+	}
+
+	refreshToken, errType := s.issueRefreshToken(ctx, user.ID, jti, "", "")
+	if errType != nil {
+		errType.Path = ".UserService->Login()" + errType.Path
+		return nil, errType
+	}
 
-	Token := jwt.New(constants.SigningMethod)
+	return &LoginResponse{
+		SessionID:    t,
+		RefreshToken: refreshToken,
+		Claims:       tClaims,
+	}, nil
+}
+
+// issueToken signs a new JWT for the given user, used by both password and
+// OAuth logins, and caches its session (keyed by "jti") in the SessionStore
+// so VerifyTokenJWT/GetByToken don't need to hit Postgres on every request
+func (s *Service) issueToken(ctx context.Context, user *User) (string, jwt.MapClaims, time.Time, *types.Error) {
+	perms, err := s.userStorage.ListPermissionsForUser(ctx, user.ID)
+	if err != nil {
+		err.Path = ".UserService->issueToken()" + err.Path
+		return "", nil, time.Time{}, err
+	}
+
+	jti, genErr := randomToken(16)
+	if genErr != nil {
+		return "", nil, time.Time{}, &types.Error{
+			Path:    ".UserService->issueToken()",
+			Message: genErr.Error(),
+			Error:   genErr,
+			Type:    "golang-error",
+		}
+	}
+
+	active := s.keyring.Active()
+	tokenExpiredAt := time.Now().Add(s.tokenConfig.AccessTTL)
+
+	Token := jwt.New(active.Method)
+	Token.Header["kid"] = active.KeyID
 	tClaims := Token.Claims.(jwt.MapClaims)
+	tClaims["jti"] = jti
+	tClaims["iss"] = s.tokenConfig.Issuer
 	tClaims["name"] = user.Name
 	tClaims["phone"] = user.Phone
 	tClaims["roleId"] = user.RoleID
+	tClaims["perms"] = perms
 	tClaims["timestamp"] = tokenExpiredAt
 	tClaims["iat"] = time.Now().Unix()
-	tClaims["exp"] = time.Now().Add(constants.ExpireTime).Unix()
-	t, errToken := Token.SignedString(constants.SignatureKey)
-	if err != nil {
-		err.Path = ".UserService->Login()" + err.Path
-		err.Message = errToken.Error()
-		return nil, err
+	tClaims["exp"] = tokenExpiredAt.Unix()
+
+	t, signErr := Token.SignedString(active.SecretKey)
+	if signErr != nil {
+		return "", nil, time.Time{}, &types.Error{
+			Path:    ".UserService->issueToken()",
+			Message: signErr.Error(),
+			Error:   signErr,
+			Type:    "golang-error",
+		}
 	}
 
-	user.Token = &t
-	user.TokenExpiredAt = &tokenExpiredAt
-	user.UpdatedAt = &now
-
-	user, err = s.userStorage.Update(ctx, user)
-	if err != nil {
-		err.Path = ".UserService->CreateUser()" + err.Path
-		return nil, err
+	session := &Session{
+		UserID:      user.ID,
+		RoleID:      user.RoleID,
+		Permissions: perms,
+		ExpiresAt:   tokenExpiredAt,
+	}
+	if err := s.sessionStore.Put(ctx, jti, session, time.Until(tokenExpiredAt)); err != nil {
+		return "", nil, time.Time{}, &types.Error{
+			Path:    ".UserService->issueToken()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "golang-error",
+		}
 	}
 
-	return &LoginResponse{
-		SessionID: t,
-		Claims:    tClaims,
-	}, nil
+	return t, tClaims, tokenExpiredAt, nil
 }
 
-// GetByToken get user by its token
+// GetByToken get user by its token. Callers rely on the full row (name,
+// phone, email, ...), so a session-store hit is resolved to the full User
+// via Storage.FindByID rather than returning the cached session's
+// denormalized id/role/permissions subset directly. This also keeps
+// GetByToken working when persistToken is off and users.token is never
+// populated, in which case Storage.FindByToken is only used as a fallback
+// for a cold session cache.
 func (s *Service) GetByToken(ctx context.Context, token string) (*User, *types.Error) {
+	if claims, err := s.parseToken(token); err == nil {
+		if jti, ok := claims["jti"].(string); ok {
+			if session, sessErr := s.sessionStore.Get(ctx, jti); sessErr == nil {
+				user, errType := s.userStorage.FindByID(ctx, session.UserID)
+				if errType != nil {
+					errType.Path = ".UserService->GetByToken()" + errType.Path
+					return nil, errType
+				}
+				return user, nil
+			}
+		}
+	}
+
 	user, err := s.userStorage.FindByToken(ctx, token)
 	if err != nil {
 		err.Path = ".UserService->GetByToken()" + err.Path
@@ -248,23 +368,42 @@ func (s *Service) GetByToken(ctx context.Context, token string) (*User, *types.E
 	return user, nil
 }
 
-// VerifyTokenJWT for verify token valid or not
-func (s *Service) VerifyTokenJWT(ctx context.Context, tokenString string) (interface{}, *types.Error) {
-	user, errType := s.GetByToken(ctx, tokenString)
-	if errType != nil {
-		errType.Path = ".UserService->VerifyTokenJWT()" + errType.Path
-		return nil, errType
-	}
-
-	token, err := jwt.Parse(*user.Token, func(token *jwt.Token) (interface{}, error) {
-		if method, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// parseToken validates a JWT's signature and expiry against the keyring
+func (s *Service) parseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Invalid Token")
-		} else if method != jwt.SigningMethodHS256 {
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		entry, ok := s.keyring.Get(kid)
+		if !ok {
 			return nil, fmt.Errorf("Invalid Token")
 		}
 
-		return constants.SignatureKey, nil
+		return entry.SecretKey, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("Invalid Token")
+	}
+
+	return claims, nil
+}
+
+// VerifyTokenJWT verifies the JWT's signature and expiry, then consults the
+// SessionStore for its "jti" so a Logout/LogoutAll revocation takes effect
+// immediately instead of waiting for the token's exp. When persistToken is
+// enabled it falls back to Postgres on a cache miss or a store error,
+// matching the historical behavior; otherwise both a missing session and a
+// store error (e.g. a Redis timeout) are treated as invalid, so a broken
+// store fails closed instead of silently skipping revocation checks.
+func (s *Service) VerifyTokenJWT(ctx context.Context, tokenString string) (interface{}, *types.Error) {
+	claims, err := s.parseToken(tokenString)
 	if err != nil {
 		return nil, &types.Error{
 			Path:    ".UserService->VerifyTokenJWT()",
@@ -273,23 +412,70 @@ func (s *Service) VerifyTokenJWT(ctx context.Context, tokenString string) (inter
 			Type:    "Invalid Token",
 		}
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return claims, nil
+	}
+
+	if _, sessErr := s.sessionStore.Get(ctx, jti); sessErr != nil {
+		// A session miss (revoked/never cached) and a broken store (e.g. a
+		// Redis timeout) are both treated as "can't confirm this token is
+		// still valid" and fall back to Postgres when available; with no
+		// fallback we fail closed rather than let an infra hiccup on the
+		// store silently skip revocation checks.
+		if s.persistToken {
+			if _, dbErr := s.userStorage.FindByToken(ctx, tokenString); dbErr == nil {
+				return claims, nil
+			}
+		}
+		if !errors.Is(sessErr, ErrSessionNotFound) {
+			return nil, &types.Error{
+				Path:    ".UserService->VerifyTokenJWT()",
+				Message: sessErr.Error(),
+				Error:   sessErr,
+				Type:    "golang-error",
+			}
+		}
 		return nil, &types.Error{
 			Path:    ".UserService->VerifyTokenJWT()",
-			Message: err.Error(),
-			Error:   err,
+			Message: ErrSessionNotFound.Error(),
+			Error:   ErrSessionNotFound,
 			Type:    "Invalid Token",
 		}
 	}
+
 	return claims, nil
 }
 
 // NewService creates a new user AppService
 func NewService(
 	userStorage Storage,
+	notifier Notifier,
+	tokenConfig TokenConfig,
+	keyring *Keyring,
+	sessionStore SessionStore,
+	persistToken bool,
 ) *Service {
+	if sessionStore == nil {
+		sessionStore = NewMemorySessionStore()
+	}
+
 	return &Service{
-		userStorage: userStorage,
+		userStorage:  userStorage,
+		notifier:     notifier,
+		resetLimiter: newResetRateLimiter(),
+		tokenConfig:  tokenConfig,
+		keyring:      keyring,
+		sessionStore: sessionStore,
+		persistToken: persistToken,
 	}
+}
+
+// PublicJWKS exposes the RSA public keys registered in the keyring as a JSON
+// Web Key Set, for services that want to verify tokens without sharing the
+// HMAC secret. issueToken signs with the active key's SecretKey, and
+// parseToken accepts only HMAC-signed tokens.
+func (s *Service) PublicJWKS() ([]byte, error) {
+	return s.keyring.PublicJWKS()
 }
\ No newline at end of file
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetByToken_HydratesFullUserFromSessionWhenPersistTokenIsOff(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Alice", Phone: "0811", Email: "alice@example.com", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	accessToken, _, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+
+	got, errType := svc.GetByToken(ctx, accessToken)
+	if errType != nil {
+		t.Fatalf("GetByToken: %v", errType)
+	}
+	if got.Name != user.Name || got.Phone != user.Phone || got.Email != user.Email {
+		t.Fatalf("GetByToken returned a zeroed/partial user: %+v", got)
+	}
+}
+
+func TestGetByToken_FallsBackToStorageOnColdCache(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(true)
+
+	legacyToken := "legacy-token"
+	user := &User{ID: 1, Name: "Bob", Phone: "0812", Token: &legacyToken, RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	got, errType := svc.GetByToken(ctx, legacyToken)
+	if errType != nil {
+		t.Fatalf("GetByToken: %v", errType)
+	}
+	if got.Name != user.Name {
+		t.Fatalf("expected GetByToken to fall back to Storage.FindByToken on a cache miss, got %+v", got)
+	}
+}
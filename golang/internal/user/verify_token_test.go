@@ -0,0 +1,127 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// brokenSessionStore simulates an unhealthy backing store (e.g. a Redis
+// timeout) by failing every Get with something other than ErrSessionNotFound
+type brokenSessionStore struct {
+	err error
+}
+
+func (b *brokenSessionStore) Get(ctx context.Context, jti string) (*Session, error) {
+	return nil, b.err
+}
+
+func (b *brokenSessionStore) Put(ctx context.Context, jti string, session *Session, ttl time.Duration) error {
+	return nil
+}
+
+func (b *brokenSessionStore) Delete(ctx context.Context, jti string) error {
+	return nil
+}
+
+func TestVerifyTokenJWT_AcceptsTokenWithCachedSession(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Alice", Phone: "0811", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	token, _, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+
+	if _, errType := svc.VerifyTokenJWT(ctx, token); errType != nil {
+		t.Fatalf("VerifyTokenJWT: %v", errType)
+	}
+}
+
+func TestVerifyTokenJWT_RejectsRevokedSessionWithoutPersistToken(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Bob", Phone: "0812", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	token, tClaims, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+	jti, _ := tClaims["jti"].(string)
+	if err := svc.sessionStore.Delete(ctx, jti); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, errType := svc.VerifyTokenJWT(ctx, token); errType == nil {
+		t.Fatalf("expected a revoked/uncached session to be rejected when persistToken is off")
+	}
+}
+
+func TestVerifyTokenJWT_FallsBackToPersistedTokenOnCacheMiss(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(true)
+
+	user := &User{ID: 1, Name: "Carol", Phone: "0813", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	token, tClaims, tokenExpiredAt, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+	jti, _ := tClaims["jti"].(string)
+	if err := svc.sessionStore.Delete(ctx, jti); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	user.Token = &token
+	user.TokenExpiredAt = &tokenExpiredAt
+
+	if _, errType := svc.VerifyTokenJWT(ctx, token); errType != nil {
+		t.Fatalf("expected VerifyTokenJWT to fall back to the persisted token, got: %v", errType)
+	}
+}
+
+func TestVerifyTokenJWT_FailsClosedOnSessionStoreError(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(false)
+
+	user := &User{ID: 1, Name: "Dana", Phone: "0814", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	token, _, _, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+
+	svc.sessionStore = &brokenSessionStore{err: errors.New("redis: connection timeout")}
+
+	if _, errType := svc.VerifyTokenJWT(ctx, token); errType == nil {
+		t.Fatalf("expected VerifyTokenJWT to fail closed when the session store errors and persistToken is off")
+	}
+}
+
+func TestVerifyTokenJWT_DegradesToPersistedTokenOnSessionStoreError(t *testing.T) {
+	ctx := context.Background()
+	svc, storage := newTestService(true)
+
+	user := &User{ID: 1, Name: "Erin", Phone: "0815", RoleID: RoleIDUser}
+	storage.users[user.ID] = user
+
+	token, _, tokenExpiredAt, errType := svc.issueToken(ctx, user)
+	if errType != nil {
+		t.Fatalf("issueToken: %v", errType)
+	}
+	user.Token = &token
+	user.TokenExpiredAt = &tokenExpiredAt
+
+	svc.sessionStore = &brokenSessionStore{err: errors.New("redis: connection timeout")}
+
+	if _, errType := svc.VerifyTokenJWT(ctx, token); errType != nil {
+		t.Fatalf("expected VerifyTokenJWT to degrade to the DB-only path, got: %v", errType)
+	}
+}